@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// ServiceCIDRProvider reconciles the service CIDRs the operator configured via
+// Kubernetes.RawServiceCIDRs against the set actually discovered on the running
+// kube-apiserver (e.g. by probing --service-cluster-ip-range or watching
+// networking.k8s.io/v1beta1 ServiceCIDR objects), and notifies subscribers when the live
+// set changes. The provider does not query the kube-apiserver itself: the discovered set
+// is whatever the caller passes to Reconcile.
+type ServiceCIDRProvider struct {
+	mu sync.Mutex
+
+	clusterSubnets *configSubnets
+	configured     []*net.IPNet
+	current        []*net.IPNet
+	subscribers    []func([]*net.IPNet)
+}
+
+// NewServiceCIDRProvider returns a ServiceCIDRProvider that validates discovered service
+// CIDRs for family agreement with configuredServiceCIDRs and for overlaps against every
+// other subnet already tracked in clusterSubnets.
+func NewServiceCIDRProvider(clusterSubnets *configSubnets, configuredServiceCIDRs []*net.IPNet) *ServiceCIDRProvider {
+	return &ServiceCIDRProvider{
+		clusterSubnets: clusterSubnets,
+		configured:     configuredServiceCIDRs,
+		current:        configuredServiceCIDRs,
+	}
+}
+
+// Subscribe registers a callback to be invoked with the new set of service CIDRs every
+// time Reconcile accepts a change, so the master and node controllers can install or
+// remove routes and OVN load-balancer VIPs for it.
+func (p *ServiceCIDRProvider) Subscribe(cb func([]*net.IPNet)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, cb)
+}
+
+// Reconcile validates a freshly-discovered set of service CIDRs against the statically
+// configured one and against every other subnet in the cluster, then notifies subscribers
+// if the change is safe to apply.
+func (p *ServiceCIDRProvider) Reconcile(discovered []*net.IPNet) error {
+	if err := p.validate(discovered); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.current = discovered
+	subscribers := append([]func([]*net.IPNet){}, p.subscribers...)
+	p.mu.Unlock()
+
+	for _, cb := range subscribers {
+		cb(discovered)
+	}
+	return nil
+}
+
+func (p *ServiceCIDRProvider) validate(discovered []*net.IPNet) error {
+	discoveredV4, discoveredV6 := false, false
+	for _, cidr := range discovered {
+		if utilnet.IsIPv6CIDR(cidr) {
+			discoveredV6 = true
+		} else {
+			discoveredV4 = true
+		}
+	}
+	configuredV4, configuredV6 := false, false
+	for _, cidr := range p.configured {
+		if utilnet.IsIPv6CIDR(cidr) {
+			configuredV6 = true
+		} else {
+			configuredV4 = true
+		}
+	}
+	if discoveredV4 != configuredV4 || discoveredV6 != configuredV6 {
+		return fmt.Errorf("kube-apiserver's service CIDRs %v disagree in IP family with the configured service CIDRs %v",
+			discovered, p.configured)
+	}
+
+	cs := newConfigSubnets()
+	for _, s := range p.clusterSubnets.subnets {
+		if s.subnetType == configSubnetService {
+			continue
+		}
+		cs.append(s.subnetType, s.subnet)
+	}
+	for _, cidr := range discovered {
+		cs.append(configSubnetService, cidr)
+	}
+	if err := cs.checkForOverlaps(); err != nil {
+		return err
+	}
+
+	isSubset, isSuperset := serviceCIDRSubsetOrSuperset(discovered, p.configured)
+	switch {
+	case isSubset && isSuperset:
+		// exact match, nothing to report
+	case isSubset:
+		klog.Warningf("kube-apiserver's discovered service CIDRs %v are a subset of the configured service CIDRs %v",
+			discovered, p.configured)
+	case isSuperset:
+		klog.Warningf("kube-apiserver's discovered service CIDRs %v are a superset of the configured service CIDRs %v",
+			discovered, p.configured)
+	default:
+		return fmt.Errorf("kube-apiserver's discovered service CIDRs %v neither contain nor are contained by the configured service CIDRs %v",
+			discovered, p.configured)
+	}
+
+	return nil
+}
+
+// serviceCIDRSubsetOrSuperset reports whether every CIDR in a is contained within some
+// CIDR in b (isSubset), and whether every CIDR in b is contained within some CIDR in a
+// (isSuperset). Both being true means a and b are equal; neither being true means the two
+// sets disagree outright.
+func serviceCIDRSubsetOrSuperset(a, b []*net.IPNet) (isSubset, isSuperset bool) {
+	return cidrsContainAll(b, a), cidrsContainAll(a, b)
+}
+
+// cidrsContainAll returns whether every CIDR in candidates is contained within some CIDR
+// in supersets.
+func cidrsContainAll(supersets, candidates []*net.IPNet) bool {
+	for _, candidate := range candidates {
+		candidateLen, _ := candidate.Mask.Size()
+		found := false
+		for _, super := range supersets {
+			superLen, _ := super.Mask.Size()
+			if candidateLen >= superLen && super.Contains(candidate.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
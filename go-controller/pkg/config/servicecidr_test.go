@@ -0,0 +1,88 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	ovntest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing"
+)
+
+func TestServiceCIDRProviderReconcile(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterCIDR []*net.IPNet
+		joinCIDR    []*net.IPNet
+		configured  []*net.IPNet
+		discovered  []*net.IPNet
+		expectedErr bool
+	}{
+		{
+			name:        "discovered matches configured",
+			clusterCIDR: ovntest.MustParseIPNets("10.128.0.0/14"),
+			joinCIDR:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			configured:  ovntest.MustParseIPNets("172.30.0.0/16"),
+			discovered:  ovntest.MustParseIPNets("172.30.0.0/16"),
+		},
+		{
+			name:        "discovered is a subset of configured",
+			clusterCIDR: ovntest.MustParseIPNets("10.128.0.0/14"),
+			joinCIDR:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			configured:  ovntest.MustParseIPNets("172.30.0.0/16", "172.31.0.0/16"),
+			discovered:  ovntest.MustParseIPNets("172.30.0.0/16"),
+		},
+		{
+			name:        "discovered disagrees in family",
+			clusterCIDR: ovntest.MustParseIPNets("10.128.0.0/14"),
+			joinCIDR:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			configured:  ovntest.MustParseIPNets("172.30.0.0/16"),
+			discovered:  ovntest.MustParseIPNets("fd00:10:96::/112"),
+			expectedErr: true,
+		},
+		{
+			name:        "discovered overlaps the cluster subnet",
+			clusterCIDR: ovntest.MustParseIPNets("172.30.0.0/16"),
+			joinCIDR:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			configured:  ovntest.MustParseIPNets("172.31.0.0/16"),
+			discovered:  ovntest.MustParseIPNets("172.30.0.0/20"),
+			expectedErr: true,
+		},
+		{
+			name:        "discovered neither contains nor is contained by configured",
+			clusterCIDR: ovntest.MustParseIPNets("10.128.0.0/14"),
+			joinCIDR:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			configured:  ovntest.MustParseIPNets("172.30.0.0/16"),
+			discovered:  ovntest.MustParseIPNets("172.40.0.0/16"),
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		clusterSubnets := newConfigSubnets()
+		for _, subnet := range tc.clusterCIDR {
+			clusterSubnets.append(configSubnetCluster, subnet)
+		}
+		for _, subnet := range tc.joinCIDR {
+			clusterSubnets.append(configSubnetJoin, subnet)
+		}
+		for _, subnet := range tc.configured {
+			clusterSubnets.append(configSubnetService, subnet)
+		}
+
+		provider := NewServiceCIDRProvider(clusterSubnets, tc.configured)
+
+		var notified []*net.IPNet
+		provider.Subscribe(func(cidrs []*net.IPNet) {
+			notified = cidrs
+		})
+
+		err := provider.Reconcile(tc.discovered)
+		if err != nil && !tc.expectedErr {
+			t.Errorf("testcase %q expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expectedErr {
+			t.Errorf("testcase %q expected an error, got none", tc.name)
+		}
+		if err == nil && len(notified) != len(tc.discovered) {
+			t.Errorf("testcase %q expected subscribers to be notified with %v, got %v", tc.name, tc.discovered, notified)
+		}
+	}
+}
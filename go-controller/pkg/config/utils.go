@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"reflect"
 	"strconv"
 	"strings"
@@ -20,11 +21,17 @@ type HostPort struct {
 type CIDRNetworkEntry struct {
 	CIDR             *net.IPNet
 	HostSubnetLength int
+
+	// ExcludedSubnets are ranges carved out of CIDR that the host subnet allocator must
+	// never hand out to a node, e.g. to reserve addresses for infrastructure.
+	ExcludedSubnets []*net.IPNet
 }
 
 // ParseClusterSubnetEntries returns the parsed set of CIDRNetworkEntries passed by the user on the command line
 // These entries define the clusters network space by specifying a set of CIDR and netmasks the SDN can allocate
-// addresses from.
+// addresses from. A entry may also carry one or more "!"-separated excluded subnets
+// (e.g. "10.128.0.0/14/23!10.128.0.0/16!10.129.0.0/16") that are reserved and will never be
+// handed out as host subnets.
 func ParseClusterSubnetEntries(clusterSubnetCmd string) ([]CIDRNetworkEntry, error) {
 	var parsedClusterList []CIDRNetworkEntry
 	clusterEntriesList := strings.Split(clusterSubnetCmd, ",")
@@ -32,7 +39,8 @@ func ParseClusterSubnetEntries(clusterSubnetCmd string) ([]CIDRNetworkEntry, err
 	for _, clusterEntry := range clusterEntriesList {
 		var parsedClusterEntry CIDRNetworkEntry
 
-		splitClusterEntry := strings.Split(clusterEntry, "/")
+		splitExclusions := strings.Split(clusterEntry, "!")
+		splitClusterEntry := strings.Split(splitExclusions[0], "/")
 
 		if len(splitClusterEntry) < 2 || len(splitClusterEntry) > 3 {
 			return nil, fmt.Errorf("CIDR %q not properly formatted", clusterEntry)
@@ -70,6 +78,31 @@ func ParseClusterSubnetEntries(clusterSubnetCmd string) ([]CIDRNetworkEntry, err
 				"host subnet length: %d, cluster subnet length: %d", parsedClusterEntry.HostSubnetLength, entryMaskLength)
 		}
 
+		for _, excludedCIDR := range splitExclusions[1:] {
+			_, excludedSubnet, err := net.ParseCIDR(excludedCIDR)
+			if err != nil {
+				return nil, fmt.Errorf("excluded subnet %q not properly formatted: %v", excludedCIDR, err)
+			}
+
+			excludedMaskLength, _ := excludedSubnet.Mask.Size()
+			if excludedMaskLength <= entryMaskLength || !parsedClusterEntry.CIDR.Contains(excludedSubnet.IP) {
+				return nil, fmt.Errorf("excluded subnet %q is not a strict subnet of cluster subnet %q",
+					excludedCIDR, parsedClusterEntry.CIDR.String())
+			}
+			if excludedMaskLength > parsedClusterEntry.HostSubnetLength {
+				return nil, fmt.Errorf("excluded subnet %q must not be smaller than the host subnet length %d",
+					excludedCIDR, parsedClusterEntry.HostSubnetLength)
+			}
+
+			for _, already := range parsedClusterEntry.ExcludedSubnets {
+				if already.Contains(excludedSubnet.IP) || excludedSubnet.Contains(already.IP) {
+					return nil, fmt.Errorf("excluded subnet %q overlaps excluded subnet %q", excludedCIDR, already.String())
+				}
+			}
+
+			parsedClusterEntry.ExcludedSubnets = append(parsedClusterEntry.ExcludedSubnets, excludedSubnet)
+		}
+
 		parsedClusterList = append(parsedClusterList, parsedClusterEntry)
 	}
 
@@ -80,6 +113,52 @@ func ParseClusterSubnetEntries(clusterSubnetCmd string) ([]CIDRNetworkEntry, err
 	return parsedClusterList, nil
 }
 
+// IPRange is the object that holds the definition for a contiguous range of addresses
+// bounded by Start and End (inclusive), e.g. as parsed by ParseIPRanges from "10.10.0.5-10.10.0.20".
+type IPRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+// ParseIPRanges returns the set of IPRanges passed by the user on the command line, for
+// allocation windows that don't align to CIDR boundaries (e.g. egress IP pools, external
+// gateway ranges). Each entry must be of the form "start-end", with start and end being IPs
+// of the same family and start <= end.
+func ParseIPRanges(rangesCmd string) ([]IPRange, error) {
+	var parsedRanges []IPRange
+
+	for _, entry := range strings.Split(rangesCmd, ",") {
+		startEnd := strings.Split(entry, "-")
+		if len(startEnd) != 2 {
+			return nil, fmt.Errorf("IP range %q not properly formatted", entry)
+		}
+
+		start, err := netip.ParseAddr(startEnd[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range start %q: %v", startEnd[0], err)
+		}
+		end, err := netip.ParseAddr(startEnd[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range end %q: %v", startEnd[1], err)
+		}
+
+		if start.Is4() != end.Is4() {
+			return nil, fmt.Errorf("IP range %q: start and end must be the same IP family", entry)
+		}
+		if start.Compare(end) > 0 {
+			return nil, fmt.Errorf("IP range %q: start %s is after end %s", entry, start, end)
+		}
+
+		parsedRanges = append(parsedRanges, IPRange{Start: net.IP(start.AsSlice()), End: net.IP(end.AsSlice())})
+	}
+
+	if len(parsedRanges) == 0 {
+		return nil, fmt.Errorf("failed to parse any IP ranges from %q", rangesCmd)
+	}
+
+	return parsedRanges, nil
+}
+
 // ParseFlowCollectors returns the parsed set of HostPorts passed by the user on the command line
 // These entries define the flow collectors OVS will send flow metadata by using NetFlow/SFlow/IPFIX.
 func ParseFlowCollectors(flowCollectors string) ([]HostPort, error) {
@@ -113,10 +192,11 @@ func ParseFlowCollectors(flowCollectors string) ([]HostPort, error) {
 type configSubnetType string
 
 const (
-	configSubnetJoin    configSubnetType = "built-in join subnet"
-	configSubnetCluster configSubnetType = "cluster subnet"
-	configSubnetService configSubnetType = "service subnet"
-	configSubnetHybrid  configSubnetType = "hybrid overlay subnet"
+	configSubnetJoin       configSubnetType = "built-in join subnet"
+	configSubnetCluster    configSubnetType = "cluster subnet"
+	configSubnetService    configSubnetType = "service subnet"
+	configSubnetHybrid     configSubnetType = "hybrid overlay subnet"
+	configSubnetMasquerade configSubnetType = "masquerade subnet"
 )
 
 type configSubnet struct {
@@ -124,9 +204,43 @@ type configSubnet struct {
 	subnet     *net.IPNet
 }
 
-// configSubnets represents a set of configured subnets (and their names)
+// ParseMasqueradeSubnets parses the user-provided (or default) IPv4 and IPv6 masquerade
+// subnets. Either string may be empty if that IP family is not in use, but a non-empty
+// value must parse as a CIDR of the matching family.
+func ParseMasqueradeSubnets(v4, v6 string) (v4Subnet, v6Subnet *net.IPNet, err error) {
+	if v4 != "" {
+		_, v4Subnet, err = net.ParseCIDR(v4)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid masquerade subnet %q: %v", v4, err)
+		}
+		if utilnet.IsIPv6CIDR(v4Subnet) {
+			return nil, nil, fmt.Errorf("masquerade subnet %q is not an IPv4 subnet", v4)
+		}
+	}
+	if v6 != "" {
+		_, v6Subnet, err = net.ParseCIDR(v6)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid masquerade subnet %q: %v", v6, err)
+		}
+		if !utilnet.IsIPv6CIDR(v6Subnet) {
+			return nil, nil, fmt.Errorf("masquerade subnet %q is not an IPv6 subnet", v6)
+		}
+	}
+	return v4Subnet, v6Subnet, nil
+}
+
+// configRange represents a single start-end IP range (and its name) that does not
+// necessarily align to a CIDR boundary, e.g. as parsed by ParseIPRanges.
+type configRange struct {
+	subnetType configSubnetType
+	start      netip.Addr
+	end        netip.Addr
+}
+
+// configSubnets represents a set of configured subnets and ranges (and their names)
 type configSubnets struct {
 	subnets []configSubnet
+	ranges  []configRange
 	v4      map[configSubnetType]bool
 	v6      map[configSubnetType]bool
 }
@@ -139,10 +253,12 @@ func newConfigSubnets() *configSubnets {
 	}
 }
 
-// append adds a single subnet to cs
+// append adds a single subnet to cs. join and masquerade subnets are excluded from
+// cs.v4/cs.v6 because their family is set independently of the cluster/service stack;
+// checkDualStackType verifies their family symmetry instead.
 func (cs *configSubnets) append(subnetType configSubnetType, subnet *net.IPNet) {
 	cs.subnets = append(cs.subnets, configSubnet{subnetType: subnetType, subnet: subnet})
-	if subnetType != configSubnetJoin {
+	if subnetType != configSubnetJoin && subnetType != configSubnetMasquerade {
 		if utilnet.IsIPv6CIDR(subnet) {
 			cs.v6[subnetType] = true
 		} else {
@@ -151,7 +267,51 @@ func (cs *configSubnets) append(subnetType configSubnetType, subnet *net.IPNet)
 	}
 }
 
-// checkForOverlaps checks if any of the subnets in cs overlap
+// appendRange adds a single start-end IP range to cs
+func (cs *configSubnets) appendRange(subnetType configSubnetType, ipRange IPRange) error {
+	start, ok := netip.AddrFromSlice(ipRange.Start)
+	if !ok {
+		return fmt.Errorf("invalid range start %s", ipRange.Start)
+	}
+	end, ok := netip.AddrFromSlice(ipRange.End)
+	if !ok {
+		return fmt.Errorf("invalid range end %s", ipRange.End)
+	}
+	// net.IP (e.g. from net.ParseIP) is commonly a 16-byte 4-in-6 slice even for an IPv4
+	// address, which AddrFromSlice would otherwise turn into a v4-in-6 netip.Addr that
+	// compares unequal to, and in a different order than, a plain v4 netip.Addr.
+	start, end = start.Unmap(), end.Unmap()
+
+	cs.ranges = append(cs.ranges, configRange{subnetType: subnetType, start: start, end: end})
+	if utilnet.IsIPv6(ipRange.Start) {
+		cs.v6[subnetType] = true
+	} else {
+		cs.v4[subnetType] = true
+	}
+	return nil
+}
+
+// rangeOverlapsSubnet returns whether the IP range r overlaps subnet, either because one
+// of the range's endpoints falls inside subnet, or because subnet falls entirely inside
+// the range.
+func rangeOverlapsSubnet(r configRange, subnet *net.IPNet) bool {
+	if subnet.Contains(net.IP(r.start.AsSlice())) || subnet.Contains(net.IP(r.end.AsSlice())) {
+		return true
+	}
+	subnetAddr, ok := netip.AddrFromSlice(subnet.IP)
+	if !ok {
+		return false
+	}
+	subnetAddr = subnetAddr.Unmap()
+	return r.start.Compare(subnetAddr) <= 0 && r.end.Compare(subnetAddr) >= 0
+}
+
+// rangesOverlap returns whether the two IP ranges overlap
+func rangesOverlap(a, b configRange) bool {
+	return a.start.Compare(b.end) <= 0 && b.start.Compare(a.end) <= 0
+}
+
+// checkForOverlaps checks if any of the subnets or ranges in cs overlap
 func (cs *configSubnets) checkForOverlaps() error {
 	for i, si := range cs.subnets {
 		for j := 0; j < i; j++ {
@@ -163,6 +323,87 @@ func (cs *configSubnets) checkForOverlaps() error {
 			}
 		}
 	}
+
+	for i, ri := range cs.ranges {
+		for j := 0; j < i; j++ {
+			rj := cs.ranges[j]
+			if rangesOverlap(ri, rj) {
+				return fmt.Errorf("illegal network configuration: %s %s-%s overlaps %s %s-%s",
+					ri.subnetType, ri.start, ri.end,
+					rj.subnetType, rj.start, rj.end)
+			}
+		}
+		for _, sj := range cs.subnets {
+			if rangeOverlapsSubnet(ri, sj.subnet) {
+				return fmt.Errorf("illegal network configuration: %s %s-%s overlaps %s %q",
+					ri.subnetType, ri.start, ri.end,
+					sj.subnetType, sj.subnet.String())
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigValidationError aggregates every problem found while validating a configSubnets, so
+// the user can fix them all at once instead of one failed Init attempt at a time.
+type ConfigValidationError []error
+
+func (e ConfigValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// minJoinSubnetHostsPerNode is the number of join-subnet addresses reserved for OVN
+// router ports on every node.
+const minJoinSubnetHostsPerNode = 1
+
+// maxUsableShift bounds the subnet-size computation in checkSizes so that 1<<shift stays
+// within a 64-bit int; a subnet with 2^32 or more addresses (e.g. an IPv6 /64 join
+// subnet) is always treated as "big enough".
+const maxUsableShift = 32
+
+// checkSizes rejects subnets that are too small to actually allocate addresses from,
+// aggregating every offender into a ConfigValidationError instead of stopping at the first.
+func (cs *configSubnets) checkSizes(clusterSubnets []CIDRNetworkEntry, numNodes int) error {
+	var errs ConfigValidationError
+
+	for _, entry := range clusterSubnets {
+		prefixLen, _ := entry.CIDR.Mask.Size()
+		if entry.HostSubnetLength-prefixLen < 1 {
+			errs = append(errs, fmt.Errorf("cluster subnet %q is too small to allocate at least two /%d host subnets",
+				entry.CIDR.String(), entry.HostSubnetLength))
+		}
+	}
+
+	for _, s := range cs.subnets {
+		prefixLen, totalBits := s.subnet.Mask.Size()
+		if prefixLen == totalBits {
+			errs = append(errs, fmt.Errorf("%s %q is a single address and cannot be allocated from",
+				s.subnetType, s.subnet.String()))
+			continue
+		}
+
+		switch s.subnetType {
+		case configSubnetService:
+			if totalBits == 128 && prefixLen >= 112 {
+				errs = append(errs, fmt.Errorf("service subnet %q is too small; IPv6 service subnets must be shorter than /112",
+					s.subnet.String()))
+			}
+		case configSubnetJoin:
+			shift := totalBits - prefixLen
+			if shift < maxUsableShift && (1<<shift) < numNodes*minJoinSubnetHostsPerNode {
+				errs = append(errs, fmt.Errorf("join subnet %q is too small to give every one of the %d nodes a router port",
+					s.subnet.String(), numNodes))
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -183,26 +424,60 @@ func (cs *configSubnets) describeSubnetType(subnetType configSubnetType) string
 	return familyType + " " + string(subnetType)
 }
 
+// checkDualStackType checks that, when cs is dual-stack overall, subnetType is itself
+// represented in both families. A subnetType with no subnets in cs at all passes.
+// join and masquerade subnets are deliberately excluded from
+// cs.v4/cs.v6 (see append) because they're set independently of the cluster/service stack,
+// so they need their own symmetry check instead of riding on the one below.
+func (cs *configSubnets) checkDualStackType(subnetType configSubnetType) error {
+	var hasV4, hasV6 bool
+	for _, s := range cs.subnets {
+		if s.subnetType != subnetType {
+			continue
+		}
+		if utilnet.IsIPv6CIDR(s.subnet) {
+			hasV6 = true
+		} else {
+			hasV4 = true
+		}
+	}
+	if (hasV4 || hasV6) && !(hasV4 && hasV6) {
+		return fmt.Errorf("illegal network configuration: dual-stack cluster requires both an IPv4 and an IPv6 %s", subnetType)
+	}
+	return nil
+}
+
 // checkIPFamilies determines if cs contains a valid single-stack IPv4 configuration, a
 // valid single-stack IPv6 configuration, a valid dual-stack configuration, or none of the
 // above.
 func (cs *configSubnets) checkIPFamilies() (usingIPv4, usingIPv6 bool, err error) {
 	if len(cs.v6) == 0 {
-		// Single-stack IPv4
-		return true, false, nil
+		usingIPv4, usingIPv6 = true, false
 	} else if len(cs.v4) == 0 {
-		// Single-stack IPv6
-		return false, true, nil
+		usingIPv4, usingIPv6 = false, true
 	} else if reflect.DeepEqual(cs.v4, cs.v6) {
-		// Dual-stack
-		return true, true, nil
+		usingIPv4, usingIPv6 = true, true
+	} else {
+		netConfig := cs.describeSubnetType(configSubnetCluster)
+		netConfig += ", " + cs.describeSubnetType(configSubnetService)
+		if cs.v4[configSubnetHybrid] || cs.v6[configSubnetHybrid] {
+			netConfig += ", " + cs.describeSubnetType(configSubnetHybrid)
+		}
+		return false, false, fmt.Errorf("illegal network configuration: %s", netConfig)
 	}
 
-	netConfig := cs.describeSubnetType(configSubnetCluster)
-	netConfig += ", " + cs.describeSubnetType(configSubnetService)
-	if cs.v4[configSubnetHybrid] || cs.v6[configSubnetHybrid] {
-		netConfig += ", " + cs.describeSubnetType(configSubnetHybrid)
+	if usingIPv4 && usingIPv6 {
+		var errs ConfigValidationError
+		if err := cs.checkDualStackType(configSubnetJoin); err != nil {
+			errs = append(errs, err)
+		}
+		if err := cs.checkDualStackType(configSubnetMasquerade); err != nil {
+			errs = append(errs, err)
+		}
+		if len(errs) != 0 {
+			return usingIPv4, usingIPv6, errs
+		}
 	}
 
-	return false, false, fmt.Errorf("illegal network configuration: %s", netConfig)
+	return usingIPv4, usingIPv6, nil
 }
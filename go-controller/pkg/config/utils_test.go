@@ -2,6 +2,7 @@ package config
 
 import (
 	"net"
+	"strings"
 	"testing"
 
 	ovntest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing"
@@ -107,6 +108,72 @@ func TestParseClusterSubnetEntries(t *testing.T) {
 			clusterNetworks: nil,
 			expectedErr:     true,
 		},
+		{
+			name:       "single excluded subnet",
+			cmdLineArg: "10.128.0.0/14/23!10.128.0.0/16",
+			clusterNetworks: []CIDRNetworkEntry{
+				{
+					CIDR:             ovntest.MustParseIPNet("10.128.0.0/14"),
+					HostSubnetLength: 23,
+					ExcludedSubnets:  ovntest.MustParseIPNets("10.128.0.0/16"),
+				},
+			},
+			expectedErr: false,
+		},
+		{
+			name:       "multiple excluded subnets",
+			cmdLineArg: "10.128.0.0/14/23!10.128.0.0/16!10.129.0.0/16",
+			clusterNetworks: []CIDRNetworkEntry{
+				{
+					CIDR:             ovntest.MustParseIPNet("10.128.0.0/14"),
+					HostSubnetLength: 23,
+					ExcludedSubnets:  ovntest.MustParseIPNets("10.128.0.0/16", "10.129.0.0/16"),
+				},
+			},
+			expectedErr: false,
+		},
+		{
+			name:       "IPv6 excluded subnet",
+			cmdLineArg: "fda6::/48/64!fda6:0:0:1::/64",
+			clusterNetworks: []CIDRNetworkEntry{
+				{
+					CIDR:             ovntest.MustParseIPNet("fda6::/48"),
+					HostSubnetLength: 64,
+					ExcludedSubnets:  ovntest.MustParseIPNets("fda6:0:0:1::/64"),
+				},
+			},
+			expectedErr: false,
+		},
+		{
+			name:            "malformed excluded subnet",
+			cmdLineArg:      "10.128.0.0/14/23!10.128.0.-/16",
+			clusterNetworks: nil,
+			expectedErr:     true,
+		},
+		{
+			name:            "excluded subnet not a subset of the cluster subnet",
+			cmdLineArg:      "10.128.0.0/14/23!10.1.0.0/16",
+			clusterNetworks: nil,
+			expectedErr:     true,
+		},
+		{
+			name:            "excluded subnet equal to the cluster subnet",
+			cmdLineArg:      "10.128.0.0/14/23!10.128.0.0/14",
+			clusterNetworks: nil,
+			expectedErr:     true,
+		},
+		{
+			name:            "excluded subnet smaller than the host subnet",
+			cmdLineArg:      "10.128.0.0/14/23!10.128.0.0/24",
+			clusterNetworks: nil,
+			expectedErr:     true,
+		},
+		{
+			name:            "overlapping excluded subnets",
+			cmdLineArg:      "10.128.0.0/14/23!10.128.0.0/16!10.128.128.0/17",
+			clusterNetworks: nil,
+			expectedErr:     true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -125,6 +192,15 @@ func TestParseClusterSubnetEntries(t *testing.T) {
 				if entry.HostSubnetLength != tc.clusterNetworks[index].HostSubnetLength {
 					t.Errorf("Test case \"%s\" expected entry[%d].HostSubnetLength: %d to equal tc.clusterNetworks[%d].HostSubnetLength: %d", tc.name, index, entry.HostSubnetLength, index, tc.clusterNetworks[index].HostSubnetLength)
 				}
+				if len(entry.ExcludedSubnets) != len(tc.clusterNetworks[index].ExcludedSubnets) {
+					t.Errorf("Test case \"%s\" expected entry[%d].ExcludedSubnets to have %d entries, got %d", tc.name, index, len(tc.clusterNetworks[index].ExcludedSubnets), len(entry.ExcludedSubnets))
+					continue
+				}
+				for excludedIndex, excluded := range entry.ExcludedSubnets {
+					if excluded.String() != tc.clusterNetworks[index].ExcludedSubnets[excludedIndex].String() {
+						t.Errorf("Test case \"%s\" expected entry[%d].ExcludedSubnets[%d]: %s to equal %s", tc.name, index, excludedIndex, excluded.String(), tc.clusterNetworks[index].ExcludedSubnets[excludedIndex].String())
+					}
+				}
 			}
 		}
 	}
@@ -135,6 +211,7 @@ func Test_checkForOverlap(t *testing.T) {
 		name               string
 		cidrList           []*net.IPNet
 		joinSubnetCIDRList []*net.IPNet
+		masqueradeCIDRList []*net.IPNet
 		shouldError        bool
 	}{
 		{
@@ -214,6 +291,20 @@ func Test_checkForOverlap(t *testing.T) {
 			joinSubnetCIDRList: ovntest.MustParseIPNets("100.64.0.0/16", "fd98::/64"),
 			shouldError:        true,
 		},
+		{
+			name:               "masquerade subnet overlapping a cluster subnet",
+			cidrList:           ovntest.MustParseIPNets("10.132.0.0/26"),
+			joinSubnetCIDRList: ovntest.MustParseIPNets("100.64.0.0/16", "fd98::/64"),
+			masqueradeCIDRList: ovntest.MustParseIPNets("10.132.0.0/29"),
+			shouldError:        true,
+		},
+		{
+			name:               "masquerade subnet not overlapping anything",
+			cidrList:           ovntest.MustParseIPNets("10.132.0.0/26"),
+			joinSubnetCIDRList: ovntest.MustParseIPNets("100.64.0.0/16", "fd98::/64"),
+			masqueradeCIDRList: ovntest.MustParseIPNets("169.254.169.0/29"),
+			shouldError:        false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -224,6 +315,9 @@ func Test_checkForOverlap(t *testing.T) {
 		for _, subnet := range tc.cidrList {
 			allSubnets.append(configSubnetCluster, subnet)
 		}
+		for _, subnet := range tc.masqueradeCIDRList {
+			allSubnets.append(configSubnetMasquerade, subnet)
+		}
 
 		err := allSubnets.checkForOverlaps()
 		if err == nil && tc.shouldError {
@@ -234,6 +328,194 @@ func Test_checkForOverlap(t *testing.T) {
 	}
 }
 
+func TestParseIPRanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmdLineArg  string
+		ranges      []IPRange
+		expectedErr bool
+	}{
+		{
+			name:       "single v4 range",
+			cmdLineArg: "10.10.0.5-10.10.0.20",
+			ranges:     []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")}},
+		},
+		{
+			name:       "single v6 range",
+			cmdLineArg: "2001:db8::1-2001:db8::ff",
+			ranges:     []IPRange{{Start: net.ParseIP("2001:db8::1"), End: net.ParseIP("2001:db8::ff")}},
+		},
+		{
+			name:       "multiple ranges",
+			cmdLineArg: "10.10.0.5-10.10.0.20,10.10.1.5-10.10.1.20",
+			ranges: []IPRange{
+				{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")},
+				{Start: net.ParseIP("10.10.1.5"), End: net.ParseIP("10.10.1.20")},
+			},
+		},
+		{
+			name:       "single address range",
+			cmdLineArg: "10.10.0.5-10.10.0.5",
+			ranges:     []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.5")}},
+		},
+		{
+			name:        "empty cmdLineArg",
+			cmdLineArg:  "",
+			expectedErr: true,
+		},
+		{
+			name:        "missing end",
+			cmdLineArg:  "10.10.0.5",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed start",
+			cmdLineArg:  "10.10.0.-10.10.0.20",
+			expectedErr: true,
+		},
+		{
+			name:        "mismatched families",
+			cmdLineArg:  "10.10.0.5-2001:db8::ff",
+			expectedErr: true,
+		},
+		{
+			name:        "start after end",
+			cmdLineArg:  "10.10.0.20-10.10.0.5",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		parsed, err := ParseIPRanges(tc.cmdLineArg)
+		if err != nil && !tc.expectedErr {
+			t.Errorf("Test case %q expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expectedErr {
+			t.Errorf("Test case %q expected an error, got none", tc.name)
+		}
+		if len(parsed) != len(tc.ranges) {
+			t.Errorf("Test case %q expected %d ranges, got %d", tc.name, len(tc.ranges), len(parsed))
+			continue
+		}
+		for i, r := range parsed {
+			if !r.Start.Equal(tc.ranges[i].Start) || !r.End.Equal(tc.ranges[i].End) {
+				t.Errorf("Test case %q expected range[%d] %s-%s, got %s-%s", tc.name, i, tc.ranges[i].Start, tc.ranges[i].End, r.Start, r.End)
+			}
+		}
+	}
+}
+
+func Test_checkForOverlapRanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		cidrList    []*net.IPNet
+		ranges      []IPRange
+		shouldError bool
+	}{
+		{
+			name:   "range not overlapping any subnet",
+			ranges: []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")}},
+		},
+		{
+			name:        "range overlapping a subnet at its start",
+			cidrList:    ovntest.MustParseIPNets("10.10.0.0/28"),
+			ranges:      []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.1.0")}},
+			shouldError: true,
+		},
+		{
+			name:        "range entirely inside a subnet",
+			cidrList:    ovntest.MustParseIPNets("10.10.0.0/24"),
+			ranges:      []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")}},
+			shouldError: true,
+		},
+		{
+			name:        "subnet entirely inside a range",
+			cidrList:    ovntest.MustParseIPNets("10.10.0.64/28"),
+			ranges:      []IPRange{{Start: net.ParseIP("10.10.0.0"), End: net.ParseIP("10.10.0.255")}},
+			shouldError: true,
+		},
+		{
+			name:   "two non-overlapping ranges",
+			ranges: []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")}, {Start: net.ParseIP("10.10.0.30"), End: net.ParseIP("10.10.0.40")}},
+		},
+		{
+			name:        "two overlapping ranges",
+			ranges:      []IPRange{{Start: net.ParseIP("10.10.0.5"), End: net.ParseIP("10.10.0.20")}, {Start: net.ParseIP("10.10.0.15"), End: net.ParseIP("10.10.0.40")}},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		allSubnets := newConfigSubnets()
+		for _, subnet := range tc.cidrList {
+			allSubnets.append(configSubnetCluster, subnet)
+		}
+		for _, r := range tc.ranges {
+			if err := allSubnets.appendRange(configSubnetService, r); err != nil {
+				t.Fatalf("testcase %q: unexpected error appending range: %v", tc.name, err)
+			}
+		}
+
+		err := allSubnets.checkForOverlaps()
+		if err == nil && tc.shouldError {
+			t.Errorf("testcase %q failed to find overlap", tc.name)
+		} else if err != nil && !tc.shouldError {
+			t.Errorf("testcase %q erroneously found overlap: %v", tc.name, err)
+		}
+	}
+}
+
+func TestParseMasqueradeSubnets(t *testing.T) {
+	tests := []struct {
+		name        string
+		v4          string
+		v6          string
+		expectedErr bool
+	}{
+		{
+			name: "both empty",
+		},
+		{
+			name: "valid v4 and v6",
+			v4:   "169.254.169.0/29",
+			v6:   "fd69::/125",
+		},
+		{
+			name: "v4 only",
+			v4:   "169.254.169.0/29",
+		},
+		{
+			name:        "malformed v4",
+			v4:          "169.254.169.0",
+			expectedErr: true,
+		},
+		{
+			name:        "v4 field given an IPv6 CIDR",
+			v4:          "fd69::/125",
+			expectedErr: true,
+		},
+		{
+			name:        "v6 field given an IPv4 CIDR",
+			v6:          "169.254.169.0/29",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		v4Subnet, v6Subnet, err := ParseMasqueradeSubnets(tc.v4, tc.v6)
+		if err != nil && !tc.expectedErr {
+			t.Errorf("Test case %q expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expectedErr {
+			t.Errorf("Test case %q expected an error, got none", tc.name)
+		}
+		if tc.v4 != "" && !tc.expectedErr && v4Subnet.String() != tc.v4 {
+			t.Errorf("Test case %q expected v4Subnet %s, got %s", tc.name, tc.v4, v4Subnet.String())
+		}
+		if tc.v6 != "" && !tc.expectedErr && v6Subnet.String() != tc.v6 {
+			t.Errorf("Test case %q expected v6Subnet %s, got %s", tc.name, tc.v6, v6Subnet.String())
+		}
+	}
+}
+
 func TestParseFlowCollectors(t *testing.T) {
 	hp, err := ParseFlowCollectors("10.0.0.2:3030,:8888,[2020:1111:f::1:0933]:3333,10.0.0.3:3031")
 	if err != nil {
@@ -247,3 +529,131 @@ func TestParseFlowCollectors(t *testing.T) {
 		t.Errorf("parsed hostPorts returned unexpected results: %+v", hp)
 	}
 }
+
+func Test_checkSizes(t *testing.T) {
+	tests := []struct {
+		name            string
+		clusterSubnets  []CIDRNetworkEntry
+		serviceCIDRList []*net.IPNet
+		joinCIDRList    []*net.IPNet
+		numNodes        int
+		shouldError     bool
+	}{
+		{
+			name:            "normal-sized cluster, service and join subnets",
+			clusterSubnets:  []CIDRNetworkEntry{{CIDR: ovntest.MustParseIPNet("10.128.0.0/14"), HostSubnetLength: 24}},
+			serviceCIDRList: ovntest.MustParseIPNets("172.30.0.0/16"),
+			joinCIDRList:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			numNodes:        10,
+			shouldError:     false,
+		},
+		{
+			name:            "IPv6 service subnet too small",
+			serviceCIDRList: ovntest.MustParseIPNets("fd00:10:96::/112"),
+			shouldError:     true,
+		},
+		{
+			name:            "IPv6 service subnet large enough",
+			serviceCIDRList: ovntest.MustParseIPNets("fd00:10:96::/110"),
+			shouldError:     false,
+		},
+		{
+			name:         "join subnet too small for the number of nodes",
+			joinCIDRList: ovntest.MustParseIPNets("100.64.0.0/30"),
+			numNodes:     100,
+			shouldError:  true,
+		},
+		{
+			name:            "single-address subnet",
+			serviceCIDRList: ovntest.MustParseIPNets("172.30.0.1/32"),
+			shouldError:     true,
+		},
+		{
+			name:           "cluster subnet too small to carve out two host subnets",
+			clusterSubnets: []CIDRNetworkEntry{{CIDR: ovntest.MustParseIPNet("10.128.0.0/24"), HostSubnetLength: 24}},
+			shouldError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		allSubnets := newConfigSubnets()
+		for _, subnet := range tc.serviceCIDRList {
+			allSubnets.append(configSubnetService, subnet)
+		}
+		for _, subnet := range tc.joinCIDRList {
+			allSubnets.append(configSubnetJoin, subnet)
+		}
+
+		err := allSubnets.checkSizes(tc.clusterSubnets, tc.numNodes)
+		if err == nil && tc.shouldError {
+			t.Errorf("testcase %q expected a size error, got none", tc.name)
+		} else if err != nil && !tc.shouldError {
+			t.Errorf("testcase %q erroneously found a size error: %v", tc.name, err)
+		}
+	}
+}
+
+func Test_checkIPFamiliesDualStack(t *testing.T) {
+	tests := []struct {
+		name               string
+		clusterCIDRList    []*net.IPNet
+		serviceCIDRList    []*net.IPNet
+		joinCIDRList       []*net.IPNet
+		masqueradeCIDRList []*net.IPNet
+		shouldError        bool
+		errSubstr          string
+	}{
+		{
+			name:               "dual-stack with dual-stack join and masquerade",
+			clusterCIDRList:    ovntest.MustParseIPNets("10.128.0.0/14", "fd01::/48"),
+			serviceCIDRList:    ovntest.MustParseIPNets("172.30.0.0/16", "fd02::/112"),
+			joinCIDRList:       ovntest.MustParseIPNets("100.64.0.0/16", "fd98::/64"),
+			masqueradeCIDRList: ovntest.MustParseIPNets("169.254.169.0/29", "fd69::/125"),
+			shouldError:        false,
+		},
+		{
+			name:            "dual-stack with IPv4-only join",
+			clusterCIDRList: ovntest.MustParseIPNets("10.128.0.0/14", "fd01::/48"),
+			serviceCIDRList: ovntest.MustParseIPNets("172.30.0.0/16", "fd02::/112"),
+			joinCIDRList:    ovntest.MustParseIPNets("100.64.0.0/16"),
+			shouldError:     true,
+			errSubstr:       string(configSubnetJoin),
+		},
+		{
+			name:               "dual-stack with IPv4-only masquerade",
+			clusterCIDRList:    ovntest.MustParseIPNets("10.128.0.0/14", "fd01::/48"),
+			serviceCIDRList:    ovntest.MustParseIPNets("172.30.0.0/16", "fd02::/112"),
+			masqueradeCIDRList: ovntest.MustParseIPNets("169.254.169.0/29"),
+			shouldError:        true,
+			// masquerade asymmetry must be caught by checkDualStackType (and named as
+			// such in the error), not fall through to the generic cluster/service
+			// mismatch branch, which would never mention masquerade at all.
+			errSubstr: string(configSubnetMasquerade),
+		},
+	}
+
+	for _, tc := range tests {
+		allSubnets := newConfigSubnets()
+		for _, subnet := range tc.clusterCIDRList {
+			allSubnets.append(configSubnetCluster, subnet)
+		}
+		for _, subnet := range tc.serviceCIDRList {
+			allSubnets.append(configSubnetService, subnet)
+		}
+		for _, subnet := range tc.joinCIDRList {
+			allSubnets.append(configSubnetJoin, subnet)
+		}
+		for _, subnet := range tc.masqueradeCIDRList {
+			allSubnets.append(configSubnetMasquerade, subnet)
+		}
+
+		_, _, err := allSubnets.checkIPFamilies()
+		if err == nil && tc.shouldError {
+			t.Errorf("testcase %q expected an error, got none", tc.name)
+		} else if err != nil && !tc.shouldError {
+			t.Errorf("testcase %q erroneously found an error: %v", tc.name, err)
+		} else if err != nil && tc.errSubstr != "" && !strings.Contains(err.Error(), tc.errSubstr) {
+			t.Errorf("testcase %q expected error to mention %q, got %v", tc.name, tc.errSubstr, err)
+		}
+	}
+}